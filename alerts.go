@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/bwmarrin/discordgo"
+)
+
+const alertsBucket = "alerts"
+
+type alertOp string
+
+const (
+	opAbove alertOp = ">"
+	opBelow alertOp = "<"
+)
+
+// alert is a user's subscription to a threshold crossing on a coin's price.
+type alert struct {
+	ID        uint64    `json:"id"`
+	UserID    string    `json:"user_id"`
+	ChannelID string    `json:"channel_id"`
+	Coin      string    `json:"coin"`
+	Op        alertOp   `json:"op"`
+	Threshold float64   `json:"threshold"`
+	Once      bool      `json:"once"`
+	DM        bool      `json:"dm"`
+	Created   time.Time `json:"created"`
+}
+
+// alertStore persists alert subscriptions to a BoltDB file keyed by an
+// auto-incrementing ID, so they survive a restart of the bot.
+type alertStore struct {
+	db *bolt.DB
+}
+
+func openAlertStore(path string) (*alertStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(alertsBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &alertStore{db: db}, nil
+}
+
+func (s *alertStore) Add(a alert) (alert, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(alertsBucket))
+
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		a.ID = id
+
+		buf, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(itob(id), buf)
+	})
+
+	return a, err
+}
+
+// List returns every alert belonging to userID.
+func (s *alertStore) List(userID string) ([]alert, error) {
+	var alerts []alert
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(alertsBucket))
+		return b.ForEach(func(k, v []byte) error {
+			var a alert
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			if a.UserID == userID {
+				alerts = append(alerts, a)
+			}
+			return nil
+		})
+	})
+
+	return alerts, err
+}
+
+// All returns every alert in the store, for the evaluator to diff against.
+func (s *alertStore) All() ([]alert, error) {
+	var alerts []alert
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(alertsBucket))
+		return b.ForEach(func(k, v []byte) error {
+			var a alert
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			alerts = append(alerts, a)
+			return nil
+		})
+	})
+
+	return alerts, err
+}
+
+// Remove deletes alert id, but only if it belongs to userID.
+func (s *alertStore) Remove(id uint64, userID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(alertsBucket))
+		key := itob(id)
+
+		v := b.Get(key)
+		if v == nil {
+			return errors.New("alert not found")
+		}
+
+		var a alert
+		if err := json.Unmarshal(v, &a); err != nil {
+			return err
+		}
+		if a.UserID != userID {
+			return errors.New("alert not found")
+		}
+
+		return b.Delete(key)
+	})
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// alertLimiter rate-limits alert deliveries per user so a volatile market
+// can't turn into a message storm.
+type alertLimiter struct {
+	mu        sync.Mutex
+	perMinute int
+	sent      map[string][]time.Time
+}
+
+func newAlertLimiter(perMinute int) *alertLimiter {
+	return &alertLimiter{perMinute: perMinute, sent: make(map[string][]time.Time)}
+}
+
+func (l *alertLimiter) allow(userID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-time.Minute)
+	fresh := l.sent[userID][:0]
+	for _, t := range l.sent[userID] {
+		if t.After(cutoff) {
+			fresh = append(fresh, t)
+		}
+	}
+
+	if len(fresh) >= l.perMinute {
+		l.sent[userID] = fresh
+		return false
+	}
+
+	l.sent[userID] = append(fresh, time.Now())
+	return true
+}
+
+// prevPrices holds the last-seen price per symbol so evaluateAlerts can
+// detect a threshold crossing (edge-triggered, not level-triggered).
+var prevPrices = make(map[string]float64)
+
+// evaluateAlerts diffs the previous cached price against the latest
+// refresh for every ticker and fires any alert whose threshold was just
+// crossed. Call it after every successful ticker refresh.
+func evaluateAlerts(store *alertStore, limiter *alertLimiter, s *discordgo.Session, fresh []Ticker) {
+	all, err := store.All()
+	if err != nil {
+		log.Println("alerts: error loading subscriptions:", err)
+		return
+	}
+
+	for _, t := range fresh {
+		prev, hadPrev := prevPrices[t.Symbol]
+		prevPrices[t.Symbol] = t.Price
+		if !hadPrev {
+			continue
+		}
+
+		for _, a := range all {
+			if !strings.EqualFold(a.Coin, t.Symbol) {
+				continue
+			}
+
+			var crossed bool
+			switch a.Op {
+			case opAbove:
+				crossed = prev < a.Threshold && t.Price >= a.Threshold
+			case opBelow:
+				crossed = prev > a.Threshold && t.Price <= a.Threshold
+			}
+
+			if crossed {
+				deliverAlert(store, limiter, s, a, t)
+			}
+		}
+	}
+}
+
+func deliverAlert(store *alertStore, limiter *alertLimiter, s *discordgo.Session, a alert, t Ticker) {
+	if !limiter.allow(a.UserID) {
+		log.Printf("alerts: rate limited delivery for user %s", a.UserID)
+		return
+	}
+
+	msg := fmt.Sprintf("<@%s> %s crossed %s %.2f, now $%.2f", a.UserID, t.Symbol, a.Op, a.Threshold, t.Price)
+
+	var err error
+	if a.DM {
+		var ch *discordgo.Channel
+		ch, err = s.UserChannelCreate(a.UserID)
+		if err == nil {
+			_, err = s.ChannelMessageSend(ch.ID, msg)
+		}
+	} else {
+		_, err = s.ChannelMessageSend(a.ChannelID, msg)
+	}
+
+	if err != nil {
+		log.Println("alerts: error delivering alert:", err)
+	}
+
+	if a.Once {
+		if err := store.Remove(a.ID, a.UserID); err != nil {
+			log.Println("alerts: error removing one-shot alert:", err)
+		}
+	}
+}
+
+// handleAlertCommand dispatches the "!alert add|list|remove" family.
+func handleAlertCommand(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if alertStoreInst == nil || len(args) == 0 {
+		return
+	}
+
+	switch args[0] {
+	case "add":
+		handleAlertAdd(s, m, args[1:])
+	case "list":
+		handleAlertList(s, m)
+	case "remove":
+		handleAlertRemove(s, m, args[1:])
+	}
+}
+
+func handleAlertAdd(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) < 3 || len(args) > 5 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: !alert add <coin> <op> <threshold> [dm] [once]")
+		return
+	}
+
+	coin := strings.ToUpper(args[0])
+
+	op := alertOp(args[1])
+	if op != opAbove && op != opBelow {
+		s.ChannelMessageSend(m.ChannelID, "Operator must be > or <")
+		return
+	}
+
+	threshold, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Threshold must be a number")
+		return
+	}
+
+	var dm, once bool
+	for _, tok := range args[3:] {
+		switch {
+		case strings.EqualFold(tok, "dm"):
+			dm = true
+		case strings.EqualFold(tok, "once"):
+			once = true
+		default:
+			s.ChannelMessageSend(m.ChannelID, "Usage: !alert add <coin> <op> <threshold> [dm] [once]")
+			return
+		}
+	}
+
+	a, err := alertStoreInst.Add(alert{
+		UserID:    m.Author.ID,
+		ChannelID: m.ChannelID,
+		Coin:      coin,
+		Op:        op,
+		Threshold: threshold,
+		Once:      once,
+		DM:        dm,
+		Created:   time.Now(),
+	})
+	if err != nil {
+		log.Println("alerts: error saving alert:", err)
+		s.ChannelMessageSend(m.ChannelID, "Failed to save alert")
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Alert #%d set: %s %s %.2f", a.ID, coin, op, threshold))
+}
+
+func handleAlertList(s *discordgo.Session, m *discordgo.MessageCreate) {
+	alerts, err := alertStoreInst.List(m.Author.ID)
+	if err != nil {
+		log.Println("alerts: error listing alerts:", err)
+		return
+	}
+
+	if len(alerts) == 0 {
+		s.ChannelMessageSend(m.ChannelID, "You have no alerts set")
+		return
+	}
+
+	var b strings.Builder
+	for _, a := range alerts {
+		fmt.Fprintf(&b, "#%d: %s %s %.2f\n", a.ID, a.Coin, a.Op, a.Threshold)
+	}
+	s.ChannelMessageSend(m.ChannelID, b.String())
+}
+
+func handleAlertRemove(s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) != 1 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: !alert remove <id>")
+		return
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Invalid alert id")
+		return
+	}
+
+	if err := alertStoreInst.Remove(id, m.Author.ID); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Alert not found")
+		return
+	}
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Alert #%d removed", id))
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fogleman/gg"
+)
+
+const (
+	coinGeckoOHLCEndpoint = "https://api.coingecko.com/api/v3/coins/%s/ohlc"
+	chartCacheTTL         = 2 * time.Minute
+)
+
+// chartsEnabled controls whether !c ... <range> renders a PNG line chart
+// of closing prices or falls back to a Unicode sparkline in the embed footer.
+var chartsEnabled = true
+
+var chartsHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// isChartRange reports whether tok is a recognized "!c btc <range>" suffix.
+func isChartRange(tok string) bool {
+	switch tok {
+	case "24h", "7d", "30d":
+		return true
+	}
+	return false
+}
+
+func ohlcDays(rangeArg string) string {
+	switch rangeArg {
+	case "24h":
+		return "1"
+	case "30d":
+		return "30"
+	default:
+		return "7"
+	}
+}
+
+// ohlcPoint is [timestamp_ms, open, high, low, close], matching CoinGecko's
+// /coins/{id}/ohlc response shape.
+type ohlcPoint [5]float64
+
+func fetchOHLC(ctx context.Context, id, rangeArg string) ([]ohlcPoint, error) {
+	url := fmt.Sprintf(coinGeckoOHLCEndpoint+"?vs_currency=usd&days=%s", id, ohlcDays(rangeArg))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := chartsHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("coingecko: ohlc endpoint returned %d", resp.StatusCode)
+	}
+
+	var points []ohlcPoint
+	if err := json.NewDecoder(resp.Body).Decode(&points); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// chartCacheEntry holds everything a chart response can produce: a
+// rendered PNG (may be nil when charts are disabled or rendering failed)
+// and the Unicode sparkline fallback.
+type chartCacheEntry struct {
+	png       []byte
+	sparkline string
+	expires   time.Time
+}
+
+// chartCache caches rendered charts by (coin, range) for a short TTL so
+// repeated queries within the rate-limit window don't re-fetch or
+// re-render.
+type chartCache struct {
+	mu      sync.Mutex
+	entries map[string]chartCacheEntry
+}
+
+func newChartCache() *chartCache {
+	return &chartCache{entries: make(map[string]chartCacheEntry)}
+}
+
+func (c *chartCache) get(key string) (chartCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return chartCacheEntry{}, false
+	}
+	return e, true
+}
+
+func (c *chartCache) set(key string, e chartCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = e
+}
+
+func chartCacheKey(coin, rangeArg string) string {
+	return strings.ToUpper(coin) + ":" + rangeArg
+}
+
+var charts = newChartCache()
+
+// sparklineLevels are the eight Unicode block heights used for the
+// inline, image-free fallback.
+var sparklineLevels = []rune("▁▂▃▄▅▆▇█")
+
+func renderSparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	min, max := values[0], values[0]
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	span := max - min
+
+	var b strings.Builder
+	for _, v := range values {
+		idx := 0
+		if span > 0 {
+			idx = int((v - min) / span * float64(len(sparklineLevels)-1))
+		}
+		b.WriteRune(sparklineLevels[idx])
+	}
+	return b.String()
+}
+
+const (
+	chartWidth  = 600
+	chartHeight = 200
+	chartMargin = 20
+)
+
+// renderLineChartPNG draws a compact line chart of the closing prices into
+// an in-memory PNG, colored green/red by overall direction.
+func renderLineChartPNG(closes []float64) ([]byte, error) {
+	if len(closes) < 2 {
+		return nil, fmt.Errorf("charts: need at least 2 points, got %d", len(closes))
+	}
+
+	min, max := closes[0], closes[0]
+	for _, v := range closes {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	span := max - min
+	if span == 0 {
+		span = 1
+	}
+
+	dc := gg.NewContext(chartWidth, chartHeight)
+	dc.SetHexColor("#2C2F33")
+	dc.Clear()
+
+	if closes[len(closes)-1] >= closes[0] {
+		dc.SetHexColor("#2ECC71")
+	} else {
+		dc.SetHexColor("#E74C3C")
+	}
+	dc.SetLineWidth(2)
+
+	plotWidth := float64(chartWidth - 2*chartMargin)
+	plotHeight := float64(chartHeight - 2*chartMargin)
+
+	for i, v := range closes {
+		x := float64(chartMargin) + plotWidth*float64(i)/float64(len(closes)-1)
+		y := float64(chartMargin) + plotHeight*(1-(v-min)/span)
+		if i == 0 {
+			dc.MoveTo(x, y)
+		} else {
+			dc.LineTo(x, y)
+		}
+	}
+	dc.Stroke()
+
+	var buf bytes.Buffer
+	if err := dc.EncodePNG(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// loadChart fetches (or returns the cached) chart data for coin over
+// rangeArg, rendering the sparkline fallback and, when chartsEnabled, the
+// PNG.
+func loadChart(id, rangeArg string) (chartCacheEntry, error) {
+	key := chartCacheKey(id, rangeArg)
+	if entry, ok := charts.get(key); ok {
+		return entry, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	points, err := fetchOHLC(ctx, id, rangeArg)
+	if err != nil {
+		return chartCacheEntry{}, err
+	}
+	if len(points) == 0 {
+		return chartCacheEntry{}, fmt.Errorf("charts: no ohlc data for %q", id)
+	}
+
+	closes := make([]float64, len(points))
+	for i, p := range points {
+		closes[i] = p[4]
+	}
+
+	entry := chartCacheEntry{
+		sparkline: renderSparkline(closes),
+		expires:   time.Now().Add(chartCacheTTL),
+	}
+
+	if chartsEnabled {
+		png, err := renderLineChartPNG(closes)
+		if err != nil {
+			log.Println("charts: error rendering chart:", err)
+		} else {
+			entry.png = png
+		}
+	}
+
+	charts.set(key, entry)
+	return entry, nil
+}
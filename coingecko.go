@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const coinGeckoMarketsEndpoint = "https://api.coingecko.com/api/v3/coins/markets"
+
+// coinGecko is a PriceSource backed by CoinGecko's free, keyless API. It
+// exists alongside coinMarketCapPro so the bot works out of the box without
+// any API key configured.
+type coinGecko struct {
+	client *http.Client
+}
+
+func newCoinGecko() *coinGecko {
+	return &coinGecko{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type geckoMarket struct {
+	ID                                 string    `json:"id"`
+	Symbol                             string    `json:"symbol"`
+	Name                               string    `json:"name"`
+	CurrentPrice                       float64   `json:"current_price"`
+	MarketCap                          float64   `json:"market_cap"`
+	MarketCapRank                      int       `json:"market_cap_rank"`
+	PriceChangePercentage1hInCurrency  float64   `json:"price_change_percentage_1h_in_currency"`
+	PriceChangePercentage24hInCurrency float64   `json:"price_change_percentage_24h_in_currency"`
+	PriceChangePercentage7dInCurrency  float64   `json:"price_change_percentage_7d_in_currency"`
+	LastUpdated                        time.Time `json:"last_updated"`
+}
+
+func (g *coinGecko) List(ctx context.Context) ([]Ticker, error) {
+	return g.markets(ctx, "usd", "", 250)
+}
+
+func (g *coinGecko) Quote(ctx context.Context, id, vsCurrency string) (Ticker, error) {
+	if vsCurrency == "" {
+		vsCurrency = "usd"
+	}
+
+	tickers, err := g.markets(ctx, vsCurrency, id, 1)
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	if len(tickers) == 0 {
+		return Ticker{}, fmt.Errorf("coingecko: no data for %q in %q", id, vsCurrency)
+	}
+
+	return tickers[0], nil
+}
+
+// Profile implements PriceSource. t.ID is already a CoinGecko id (see
+// geckoMarketToTicker), so it needs no translation for chart lookups.
+func (g *coinGecko) Profile(t Ticker) sourceProfile {
+	return sourceProfile{
+		Name:    "CoinGecko",
+		URL:     "https://www.coingecko.com/en/coins/" + t.ID,
+		ChartID: t.ID,
+	}
+}
+
+func (g *coinGecko) markets(ctx context.Context, vsCurrency, id string, perPage int) ([]Ticker, error) {
+	q := url.Values{}
+	q.Set("vs_currency", vsCurrency)
+	q.Set("order", "market_cap_desc")
+	q.Set("per_page", fmt.Sprintf("%d", perPage))
+	q.Set("page", "1")
+	q.Set("price_change_percentage", "1h,24h,7d")
+	if id != "" {
+		q.Set("ids", id)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, coinGeckoMarketsEndpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("coingecko: markets endpoint returned %d", resp.StatusCode)
+	}
+
+	var raw []geckoMarket
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	tickers := make([]Ticker, 0, len(raw))
+	for _, m := range raw {
+		tickers = append(tickers, geckoMarketToTicker(m, vsCurrency))
+	}
+	return tickers, nil
+}
+
+func geckoMarketToTicker(m geckoMarket, vsCurrency string) Ticker {
+	return Ticker{
+		ID:          m.ID,
+		Name:        m.Name,
+		Symbol:      strings.ToUpper(m.Symbol),
+		Rank:        m.MarketCapRank,
+		Fiat:        strings.ToUpper(vsCurrency),
+		Price:       m.CurrentPrice,
+		MarketCap:   m.MarketCap,
+		Change1H:    m.PriceChangePercentage1hInCurrency,
+		Change24H:   m.PriceChangePercentage24hInCurrency,
+		Change7D:    m.PriceChangePercentage7dInCurrency,
+		LastUpdated: m.LastUpdated,
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cmcProBaseURL    = "https://pro-api.coinmarketcap.com"
+	cmcListEndpoint  = cmcProBaseURL + "/v1/cryptocurrency/listings/latest"
+	cmcQuoteEndpoint = cmcProBaseURL + "/v2/cryptocurrency/quotes/latest"
+
+	// defaultCreditsPerDay is a conservative spend ceiling chosen so a
+	// basic-plan key won't be exhausted by scheduled polling alone.
+	defaultCreditsPerDay = 3000
+)
+
+// cmcSlugToGeckoID maps CMC slugs that diverge from CoinGecko's own id
+// space. Chart data always comes from CoinGecko (see charts.go) regardless
+// of the active PriceSource, so a CMC-sourced ticker needs translating
+// before it can be used to fetch OHLC data. Not exhaustive - just the
+// common cases where the two providers' slugs disagree; anything absent
+// here is passed through unchanged, which is correct for most coins.
+var cmcSlugToGeckoID = map[string]string{
+	"xrp":       "ripple",
+	"bnb":       "binancecoin",
+	"avalanche": "avalanche-2",
+}
+
+// coinMarketCapPro is a PriceSource backed by the CoinMarketCap Pro API.
+// It requires an API key, read from config or the CMC_PRO_API_KEY
+// environment variable, and tracks a rolling credit budget so scheduled
+// polling doesn't blow through the configured plan quota.
+type coinMarketCapPro struct {
+	apiKey string
+	client *http.Client
+
+	mu      sync.Mutex
+	credits creditBudget
+}
+
+// creditBudget tracks API credits spent within a rolling window so callers
+// can back off before exceeding the plan quota.
+type creditBudget struct {
+	max         int
+	used        int
+	windowStart time.Time
+	window      time.Duration
+}
+
+func (b *creditBudget) allow(cost int) bool {
+	now := time.Now()
+	if now.Sub(b.windowStart) > b.window {
+		b.windowStart = now
+		b.used = 0
+	}
+	if b.max > 0 && b.used+cost > b.max {
+		return false
+	}
+	b.used += cost
+	return true
+}
+
+func newCoinMarketCapPro(c config) *coinMarketCapPro {
+	key := c.CMCAPIKey
+	if key == "" {
+		key = os.Getenv("CMC_PRO_API_KEY")
+	}
+
+	maxCredits := c.CMCCreditsPerDay
+	if maxCredits == 0 {
+		maxCredits = defaultCreditsPerDay
+	}
+
+	return &coinMarketCapPro{
+		apiKey: key,
+		client: &http.Client{Timeout: 10 * time.Second},
+		credits: creditBudget{
+			max:         maxCredits,
+			windowStart: time.Now(),
+			window:      24 * time.Hour,
+		},
+	}
+}
+
+type cmcResponse struct {
+	Status struct {
+		ErrorCode    int    `json:"error_code"`
+		ErrorMessage string `json:"error_message"`
+		CreditCount  int    `json:"credit_count"`
+	} `json:"status"`
+	Data json.RawMessage `json:"data"`
+}
+
+type cmcQuoteUSD struct {
+	Price            float64   `json:"price"`
+	MarketCap        float64   `json:"market_cap"`
+	PercentChange1h  float64   `json:"percent_change_1h"`
+	PercentChange24h float64   `json:"percent_change_24h"`
+	PercentChange7d  float64   `json:"percent_change_7d"`
+	LastUpdated      time.Time `json:"last_updated"`
+}
+
+type cmcCoin struct {
+	Name    string                 `json:"name"`
+	Symbol  string                 `json:"symbol"`
+	Slug    string                 `json:"slug"`
+	CMCRank int                    `json:"cmc_rank"`
+	Quote   map[string]cmcQuoteUSD `json:"quote"`
+}
+
+func (c *coinMarketCapPro) List(ctx context.Context) ([]Ticker, error) {
+	var coins []cmcCoin
+	if err := c.getJSON(ctx, cmcListEndpoint+"?limit=200&convert=USD", 1, &coins); err != nil {
+		return nil, err
+	}
+
+	tickers := make([]Ticker, 0, len(coins))
+	for _, coin := range coins {
+		tickers = append(tickers, cmcCoinToTicker(coin, "USD"))
+	}
+	return tickers, nil
+}
+
+func (c *coinMarketCapPro) Quote(ctx context.Context, id, vsCurrency string) (Ticker, error) {
+	if vsCurrency == "" {
+		vsCurrency = "USD"
+	}
+	vsCurrency = strings.ToUpper(vsCurrency)
+
+	url := fmt.Sprintf("%s?slug=%s&convert=%s", cmcQuoteEndpoint, strings.ToLower(id), vsCurrency)
+
+	var payload map[string]cmcCoin
+	if err := c.getJSON(ctx, url, 1, &payload); err != nil {
+		return Ticker{}, err
+	}
+
+	for _, coin := range payload {
+		return cmcCoinToTicker(coin, vsCurrency), nil
+	}
+
+	return Ticker{}, fmt.Errorf("coinmarketcappro: no data for %q", id)
+}
+
+// Profile implements PriceSource.
+func (c *coinMarketCapPro) Profile(t Ticker) sourceProfile {
+	chartID := t.ID
+	if mapped, ok := cmcSlugToGeckoID[t.ID]; ok {
+		chartID = mapped
+	}
+
+	return sourceProfile{
+		Name:    "CoinMarketCap",
+		URL:     "https://coinmarketcap.com/currencies/" + t.ID,
+		IconURL: fmt.Sprintf("https://files.coinmarketcap.com/static/img/coins/32x32/%s.png", t.ID),
+		ChartID: chartID,
+	}
+}
+
+// getJSON performs an authenticated request against the Pro API, retrying
+// with exponential backoff when rate-limited (HTTP 429), and unmarshals
+// the "data" field of the response envelope into v.
+func (c *coinMarketCapPro) getJSON(ctx context.Context, url string, cost int, v interface{}) error {
+	c.mu.Lock()
+	allowed := c.credits.allow(cost)
+	c.mu.Unlock()
+	if !allowed {
+		return errors.New("coinmarketcappro: credit budget exhausted for this window")
+	}
+
+	backoff := time.Second
+	const maxAttempts = 5
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-CMC_PRO_API_KEY", c.apiKey)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			log.Printf("coinmarketcappro: rate limited, backing off %s", backoff)
+			time.Sleep(backoff)
+			backoff = time.Duration(math.Min(float64(backoff*2), float64(time.Minute)))
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("coinmarketcappro: endpoint returned %d", resp.StatusCode)
+		}
+
+		var envelope cmcResponse
+		err = json.NewDecoder(resp.Body).Decode(&envelope)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if envelope.Status.ErrorCode != 0 {
+			return fmt.Errorf("coinmarketcappro: %s", envelope.Status.ErrorMessage)
+		}
+
+		return json.Unmarshal(envelope.Data, v)
+	}
+
+	return fmt.Errorf("coinmarketcappro: exceeded retry attempts for %s", url)
+}
+
+func cmcCoinToTicker(c cmcCoin, vsCurrency string) Ticker {
+	id := c.Slug
+	if id == "" {
+		id = strings.ToLower(c.Symbol)
+	}
+
+	q := c.Quote[vsCurrency]
+
+	return Ticker{
+		ID:          id,
+		Name:        c.Name,
+		Symbol:      c.Symbol,
+		Rank:        c.CMCRank,
+		Fiat:        vsCurrency,
+		Price:       q.Price,
+		MarketCap:   q.MarketCap,
+		Change1H:    q.PercentChange1h,
+		Change24H:   q.PercentChange24h,
+		Change7D:    q.PercentChange7d,
+		LastUpdated: q.LastUpdated,
+	}
+}
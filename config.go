@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/fsnotify/fsnotify"
+)
+
+// ChannelConfig holds the per-channel settings that used to be baked into
+// the binary (the `channels` slice and the `rateLimit` constant). Keeping
+// them in config means adding a server no longer requires a redeploy.
+type ChannelConfig struct {
+	ID string `json:"id"`
+	// RateLimit is a time.ParseDuration string, e.g. "30s". Empty means
+	// defaultChannelRateLimit.
+	RateLimit string `json:"rate_limit"`
+	// AllowedCommands restricts which command triggers (e.g. "!c",
+	// "!alert", "!btc") this channel responds to. Empty means all of them.
+	AllowedCommands []string `json:"allowed_commands"`
+	// DefaultFiat overrides the global default vs_currency for this channel.
+	DefaultFiat string `json:"default_fiat"`
+}
+
+const defaultChannelRateLimit = 30 * time.Second
+
+// legacyDefaultChannels is seeded into a config file that doesn't specify
+// any channels yet, so bots upgrading from the hardcoded-slice era keep
+// working without edits.
+var legacyDefaultChannels = []string{"322882023825997845", "229807580367683584"}
+
+// configStore is the live, mutable view of the on-disk config. Admin
+// commands mutate it in memory and persist the change back to disk
+// atomically; an fsnotify watch reloads it when the file changes out from
+// under the bot.
+type configStore struct {
+	mu   sync.RWMutex
+	path string
+	cfg  config
+}
+
+func loadConfigStore(path string) (*configStore, error) {
+	cs := &configStore{path: path}
+	if err := cs.Reload(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// Reload re-reads the config file from disk, replacing the in-memory copy.
+func (cs *configStore) Reload() error {
+	file, err := ioutil.ReadFile(cs.path)
+	if err != nil {
+		return err
+	}
+
+	var cfg config
+	if err := json.Unmarshal(file, &cfg); err != nil {
+		return err
+	}
+
+	// Distinguish "channels key absent" (pre-migration config, or a fresh
+	// file) from "channels key present but empty" (an admin disabled the
+	// last channel) - both unmarshal cfg.Channels to a zero-length slice,
+	// so only a pointer probe of the raw key can tell them apart.
+	var probe struct {
+		Channels *[]ChannelConfig `json:"channels"`
+	}
+	if err := json.Unmarshal(file, &probe); err != nil {
+		return err
+	}
+	if probe.Channels == nil {
+		for _, id := range legacyDefaultChannels {
+			cfg.Channels = append(cfg.Channels, ChannelConfig{ID: id})
+		}
+	}
+
+	cs.mu.Lock()
+	cs.cfg = cfg
+	cs.mu.Unlock()
+
+	return nil
+}
+
+// Save writes the current in-memory config back to disk atomically (write
+// to a temp file, then rename over the original).
+func (cs *configStore) Save() error {
+	cs.mu.RLock()
+	buf, err := json.MarshalIndent(cs.cfg, "", "  ")
+	cs.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(cs.path)
+	tmp, err := ioutil.TempFile(dir, ".config-*.json.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), cs.path)
+}
+
+// Get returns a snapshot of the current config.
+func (cs *configStore) Get() config {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.cfg
+}
+
+// Channel returns the config for channelID, if it's enabled.
+func (cs *configStore) Channel(channelID string) (ChannelConfig, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	for _, c := range cs.cfg.Channels {
+		if c.ID == channelID {
+			return c, true
+		}
+	}
+	return ChannelConfig{}, false
+}
+
+// RateLimit returns channelID's configured rate limit, or the default.
+func (cs *configStore) RateLimit(channelID string) time.Duration {
+	cc, found := cs.Channel(channelID)
+	if !found || cc.RateLimit == "" {
+		return defaultChannelRateLimit
+	}
+
+	d, err := time.ParseDuration(cc.RateLimit)
+	if err != nil {
+		return defaultChannelRateLimit
+	}
+	return d
+}
+
+// CommandAllowed reports whether cmd may run in channelID.
+func (cs *configStore) CommandAllowed(channelID, cmd string) bool {
+	cc, found := cs.Channel(channelID)
+	if !found {
+		return false
+	}
+	if len(cc.AllowedCommands) == 0 {
+		return true
+	}
+	return isInSlice(cmd, cc.AllowedCommands)
+}
+
+// IsOwner reports whether userID is listed in config.Owners.
+func (cs *configStore) IsOwner(userID string) bool {
+	return isInSlice(userID, cs.Get().Owners)
+}
+
+// enableChannel adds channelID to the config (a no-op if already present)
+// and returns its resulting ChannelConfig.
+func (cs *configStore) enableChannel(channelID string) ChannelConfig {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, c := range cs.cfg.Channels {
+		if c.ID == channelID {
+			return c
+		}
+	}
+
+	cc := ChannelConfig{ID: channelID}
+	cs.cfg.Channels = append(cs.cfg.Channels, cc)
+	return cc
+}
+
+// disableChannel removes channelID from the config. It reports whether the
+// channel was present beforehand.
+func (cs *configStore) disableChannel(channelID string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for i, c := range cs.cfg.Channels {
+		if c.ID == channelID {
+			cs.cfg.Channels = append(cs.cfg.Channels[:i], cs.cfg.Channels[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// setRateLimit updates channelID's rate limit, creating the channel entry
+// if it doesn't exist yet.
+func (cs *configStore) setRateLimit(channelID, rateLimit string) ChannelConfig {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for i, c := range cs.cfg.Channels {
+		if c.ID == channelID {
+			cs.cfg.Channels[i].RateLimit = rateLimit
+			return cs.cfg.Channels[i]
+		}
+	}
+
+	cc := ChannelConfig{ID: channelID, RateLimit: rateLimit}
+	cs.cfg.Channels = append(cs.cfg.Channels, cc)
+	return cc
+}
+
+// watch starts an fsnotify watch on the config file and reloads it on
+// every write, so config changes made outside the bot (or by another
+// instance) are picked up without a restart.
+func (cs *configStore) watch() {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("config: could not start file watcher:", err)
+		return
+	}
+
+	if err := watcher.Add(filepath.Dir(cs.path)); err != nil {
+		log.Println("config: could not watch config directory:", err)
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(cs.path) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := cs.Reload(); err != nil {
+					log.Println("config: error reloading after file change:", err)
+					continue
+				}
+				log.Println("config: reloaded after external file change")
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("config: watcher error:", err)
+			}
+		}
+	}()
+}
+
+// parseChannelArg accepts a Discord channel mention ("<#123>"), a bare
+// "#123", or a raw channel ID, returning just the ID.
+func parseChannelArg(arg string) string {
+	arg = strings.TrimPrefix(arg, "<#")
+	arg = strings.TrimSuffix(arg, ">")
+	arg = strings.TrimPrefix(arg, "#")
+	return arg
+}
+
+// handleAdminCommand dispatches the owner-gated "!c-admin ..." family.
+func handleAdminCommand(cs *configStore, s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if !cs.IsOwner(m.Author.ID) {
+		return
+	}
+	if len(args) == 0 {
+		return
+	}
+
+	switch args[0] {
+	case "enable":
+		handleAdminEnable(cs, s, m, args[1:])
+	case "disable":
+		handleAdminDisable(cs, s, m, args[1:])
+	case "ratelimit":
+		handleAdminRateLimit(cs, s, m, args[1:])
+	case "reload":
+		handleAdminReload(cs, s, m)
+	}
+}
+
+func handleAdminEnable(cs *configStore, s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) != 1 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: !c-admin enable <#channel>")
+		return
+	}
+
+	id := parseChannelArg(args[0])
+	before, existed := cs.Channel(id)
+	after := cs.enableChannel(id)
+	persistAdminChange(cs, m.Author.ID, fmt.Sprintf("enable channel %s", id), existed, before, after)
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Enabled <#%s>", id))
+}
+
+func handleAdminDisable(cs *configStore, s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) != 1 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: !c-admin disable <#channel>")
+		return
+	}
+
+	id := parseChannelArg(args[0])
+	before, existed := cs.Channel(id)
+	cs.disableChannel(id)
+	persistAdminChange(cs, m.Author.ID, fmt.Sprintf("disable channel %s", id), existed, before, ChannelConfig{})
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Disabled <#%s>", id))
+}
+
+func handleAdminRateLimit(cs *configStore, s *discordgo.Session, m *discordgo.MessageCreate, args []string) {
+	if len(args) != 1 {
+		s.ChannelMessageSend(m.ChannelID, "Usage: !c-admin ratelimit <duration, e.g. 10s>")
+		return
+	}
+
+	if _, err := time.ParseDuration(args[0]); err != nil {
+		s.ChannelMessageSend(m.ChannelID, "Invalid duration")
+		return
+	}
+
+	before, existed := cs.Channel(m.ChannelID)
+	after := cs.setRateLimit(m.ChannelID, args[0])
+	persistAdminChange(cs, m.Author.ID, fmt.Sprintf("ratelimit channel %s", m.ChannelID), existed, before, after)
+
+	s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Rate limit set to %s", args[0]))
+}
+
+func handleAdminReload(cs *configStore, s *discordgo.Session, m *discordgo.MessageCreate) {
+	if err := cs.Reload(); err != nil {
+		log.Println("admin: error reloading config:", err)
+		s.ChannelMessageSend(m.ChannelID, "Reload failed, see logs")
+		return
+	}
+
+	log.Printf("admin: %s reloaded config from disk", m.Author.ID)
+	s.ChannelMessageSend(m.ChannelID, "Config reloaded")
+}
+
+// persistAdminChange logs the mutation for auditability and writes it to
+// disk, so it survives a restart.
+func persistAdminChange(cs *configStore, adminID, action string, existed bool, before, after ChannelConfig) {
+	log.Printf("admin: %s ran %q (existed=%v before=%+v after=%+v)", adminID, action, existed, before, after)
+
+	if err := cs.Save(); err != nil {
+		log.Println("admin: error persisting config change:", err)
+	}
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
+	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
+	"math"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -18,45 +16,56 @@ import (
 	"github.com/dustin/go-humanize"
 )
 
-type (
-	config struct {
-		Token string `json:"token"`
-	}
-
-	tickerResponse struct {
-		ID          string `json:"id"`
-		Name        string `json:"name"`
-		Symbol      string `json:"symbol"`
-		Rank        string `json:"rank"`
-		PriceUSD    string `json:"price_usd"`
-		PriceBTC    string `json:"price_btc"`
-		MarketCap   string `json:"market_cap_usd"`
-		Change1H    string `json:"percent_change_1h"`
-		Change24H   string `json:"percent_change_24h"`
-		Change7D    string `json:"percent_change_7d"`
-		LastUpdated string `json:"last_updated"`
-	}
-)
+type config struct {
+	Token string `json:"token"`
+
+	// Source selects the PriceSource backend: "coinmarketcappro" (default)
+	// or "coingecko".
+	Source           string `json:"source"`
+	CMCAPIKey        string `json:"cmc_api_key"`
+	CMCCreditsPerDay int    `json:"cmc_credits_per_day"`
+
+	// DefaultFiat is the vs_currency used when a command doesn't specify one.
+	DefaultFiat string `json:"default_fiat"`
+	// Shortcuts lists symbols that get their own "!<symbol>" trigger, in
+	// addition to the general "!c <symbol>" command.
+	Shortcuts []string `json:"shortcuts"`
+
+	// AlertsDBPath is where price alert subscriptions are persisted.
+	AlertsDBPath string `json:"alerts_db_path"`
+	// AlertsPerMinute caps how many alert deliveries a single user can
+	// receive per minute.
+	AlertsPerMinute int `json:"alerts_per_minute"`
+
+	// DisableImageCharts forces the "!c btc 7d" chart commands to fall
+	// back to the inline Unicode sparkline instead of rendering a PNG.
+	DisableImageCharts bool `json:"disable_image_charts"`
+
+	// Channels lists the channels the bot listens in, and their
+	// per-channel overrides. See ChannelConfig.
+	Channels []ChannelConfig `json:"channels"`
+	// Owners lists the Discord user IDs allowed to run "!c-admin" commands.
+	Owners []string `json:"owners"`
+}
 
 const (
-	tickerListEndpoint = "https://api.coinmarketcap.com/v1/ticker/?limit=0"
-	tickerEndpoint     = "https://api.coinmarketcap.com/v1/ticker/"
+	colorUp   = 0x2ECC71
+	colorDown = 0xE74C3C
 )
 
 var (
-	tickers      = make([]tickerResponse, 0)
-	rateLimit    = time.Second * 30
-	updateRate   = time.Minute * 5
-	lastMessages = make(map[string]time.Time)
-	channels     = []string{"322882023825997845", "229807580367683584"}
+	session          *discordgo.Session
+	source           PriceSource
+	liveStream       *streamer
+	alertStoreInst   *alertStore
+	alertLimiterInst *alertLimiter
+	cfgStore         *configStore
+	tickers          = make([]Ticker, 0)
+	updateRate       = time.Minute * 5
+	lastMessages     = make(map[string]time.Time)
+	shortcuts        = []string{"btc", "eth", "doge", "bsc"}
 )
 
-func init() {
-	for _, c := range channels {
-		lastMessages[c] = time.Now()
-	}
-}
-
 func main() {
 
 	var configFile string
@@ -66,28 +75,58 @@ func main() {
 		log.Fatalln("Please provide a configuration file as a second parameter")
 	}
 
-	file, err := ioutil.ReadFile(configFile)
+	cs, err := loadConfigStore(configFile)
 	if err != nil {
 		log.Printf("There was an error opening the file %s", configFile)
 		log.Fatalln(err)
 	}
+	cfgStore = cs
+	config := cs.Get()
+
+	source = newPriceSource(config)
+
+	if len(config.Shortcuts) > 0 {
+		shortcuts = config.Shortcuts
+	}
+
+	alertsPath := config.AlertsDBPath
+	if alertsPath == "" {
+		alertsPath = "alerts.db"
+	}
+	alertStoreInst, err = openAlertStore(alertsPath)
+	if err != nil {
+		log.Println("alerts: failed to open store, alert commands disabled:", err)
+	}
 
-	var config config
-	json.Unmarshal(file, &config)
+	alertsPerMinute := config.AlertsPerMinute
+	if alertsPerMinute == 0 {
+		alertsPerMinute = 3
+	}
+	alertLimiterInst = newAlertLimiter(alertsPerMinute)
+
+	if config.DisableImageCharts {
+		chartsEnabled = false
+	}
 
 	bot, err := discordgo.New("Bot " + config.Token)
 	if err != nil {
 		log.Println("Error creating discord client")
 		log.Fatalln(err)
 	}
+	session = bot
 
 	bot.AddHandler(messageHandler)
 
 	bot.Open()
 	defer bot.Close()
 
+	cfgStore.watch()
+
 	loadTickers()
 
+	liveStream = newStreamer()
+	go liveStream.run()
+
 	t := time.NewTimer(updateRate)
 	go func() {
 		for range t.C {
@@ -101,92 +140,142 @@ func main() {
 }
 
 func loadTickers() {
-	resp, err := http.Get(tickerListEndpoint)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("Tickers endpoint returned %d\n", resp.StatusCode)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	var t []tickerResponse
-	err = json.NewDecoder(resp.Body).Decode(&t)
+	t, err := source.List(ctx)
 	if err != nil {
-		log.Fatalln(err)
+		log.Println("Error loading tickers")
+		log.Println(err)
+		return
 	}
 
 	if len(t) > 0 {
 		tickers = t
 		log.Printf("Loaded %d tickers\n", len(t))
+
+		if alertStoreInst != nil && session != nil {
+			evaluateAlerts(alertStoreInst, alertLimiterInst, session, t)
+		}
 	}
 }
 
-func getTicker(id string) (tickerResponse, error) {
-	var tr tickerResponse
-	resp, err := http.Get(fmt.Sprintf("%s%s", tickerEndpoint, id))
-	if err != nil {
-		log.Println(err)
-		return tr, err
-	}
+func getTicker(id, fiat string) (Ticker, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	defer resp.Body.Close()
+	return source.Quote(ctx, id, fiat)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Ticker endpoint returned %d\n", resp.StatusCode)
-		return tr, errors.New("Bad status code")
-	}
+// messageHandler serves both the general "!c <symbol> [fiat]" command and
+// the per-coin shortcuts ("!btc [fiat]", "!eth [fiat]", ...).
+func messageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
+	cc, enabled := cfgStore.Channel(m.ChannelID)
 
-	var t []tickerResponse
-	err = json.NewDecoder(resp.Body).Decode(&t)
-	if err != nil {
-		log.Println(err)
-		return tr, err
+	msgSlice := strings.Fields(m.Message.Content)
+	if len(msgSlice) == 0 {
+		return
 	}
 
-	if len(t) != 1 {
-		return tr, errors.New("Bad response")
-	}
+	cmd := msgSlice[0]
 
-	return t[0], nil
-}
+	if cmd == "!c-admin" {
+		handleAdminCommand(cfgStore, s, m, msgSlice[1:])
+		return
+	}
 
-func messageHandler(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if !isInSlice(m.ChannelID, channels) {
+	if !enabled || !cfgStore.CommandAllowed(m.ChannelID, cmd) {
 		return
 	}
 
-	msg := m.Message.Content
-	msgSlice := strings.Split(msg, " ")
-	if len(msgSlice) != 2 {
+	if cmd == "!alert" {
+		handleAlertCommand(s, m, msgSlice[1:])
 		return
 	}
 
-	if msgSlice[0] != "!c" && msgSlice[0] != "!crypto" {
+	var symbol, fiat, rangeArg string
+	switch {
+	case cmd == "!c" || cmd == "!crypto":
+		if len(msgSlice) < 2 || len(msgSlice) > 4 {
+			return
+		}
+		symbol = msgSlice[1]
+		for _, tok := range msgSlice[2:] {
+			if isChartRange(tok) {
+				rangeArg = tok
+			} else {
+				fiat = tok
+			}
+		}
+	case isShortcut(cmd):
+		if len(msgSlice) > 3 {
+			return
+		}
+		symbol = strings.TrimPrefix(cmd, "!")
+		for _, tok := range msgSlice[1:] {
+			if isChartRange(tok) {
+				rangeArg = tok
+			} else {
+				fiat = tok
+			}
+		}
+	default:
 		return
 	}
 
-	if time.Since(lastMessages[m.ChannelID]) < rateLimit {
+	if fiat == "" {
+		fiat = cc.DefaultFiat
+	}
+	if fiat == "" {
+		fiat = cfgStore.Get().DefaultFiat
+	}
+	if fiat == "" {
+		fiat = "usd"
+	}
+
+	if time.Since(lastMessages[m.ChannelID]) < cfgStore.RateLimit(m.ChannelID) {
 		log.Println("Rate limited")
 		return
 	}
 
-	ticker, found := findTicker(msgSlice[1])
-	if found {
-		ticker, err := getTicker(ticker.ID)
-		if err == nil {
-			sendTickerMessage(ticker, s, m)
+	ticker, found := findTicker(symbol)
+	if !found {
+		return
+	}
+
+	if fiat == "usd" {
+		if live, ok := liveStream.Get(ticker.Symbol); ok {
+			sendTickerMessage(live, rangeArg, s, m)
+			return
 		}
 	}
 
+	ticker, err := getTicker(ticker.ID, fiat)
+	if err == nil {
+		sendTickerMessage(ticker, rangeArg, s, m)
+	}
+
+}
+
+func isShortcut(cmd string) bool {
+	if !strings.HasPrefix(cmd, "!") {
+		return false
+	}
+	return isInSlice(strings.TrimPrefix(cmd, "!"), shortcuts)
 }
 
-func sendTickerMessage(t tickerResponse, s *discordgo.Session, m *discordgo.MessageCreate) {
-	embed := makeEmbed(t)
+// sendTickerMessage sends the ticker embed, optionally attaching a chart
+// (image or, failing that, a Unicode sparkline footer) for rangeArg.
+func sendTickerMessage(t Ticker, rangeArg string, s *discordgo.Session, m *discordgo.MessageCreate) {
+	profile := source.Profile(t)
+	embed := makeEmbed(t, profile)
 
-	_, err := s.ChannelMessageSendEmbed(m.ChannelID, embed)
+	var err error
+	if rangeArg == "" {
+		_, err = s.ChannelMessageSendEmbed(m.ChannelID, embed)
+	} else {
+		err = sendTickerMessageWithChart(embed, profile.ChartID, rangeArg, s, m)
+	}
 
 	if err != nil {
 		log.Println("error sending message")
@@ -196,91 +285,121 @@ func sendTickerMessage(t tickerResponse, s *discordgo.Session, m *discordgo.Mess
 	lastMessages[m.ChannelID] = time.Now()
 }
 
-func makeEmbed(t tickerResponse) *discordgo.MessageEmbed {
-	embed := discordgo.MessageEmbed{}
+func sendTickerMessageWithChart(embed *discordgo.MessageEmbed, id, rangeArg string, s *discordgo.Session, m *discordgo.MessageCreate) error {
+	entry, err := loadChart(id, rangeArg)
+	if err != nil {
+		log.Println("charts: error loading chart, sending quote without one:", err)
+		_, err = s.ChannelMessageSendEmbed(m.ChannelID, embed)
+		return err
+	}
 
-	embed.Title = "Coin Market Cap"
-	embed.URL = "https://coinmarketcap.com/currencies/" + t.ID
-	// embed.Color = 25520626
+	if len(entry.png) == 0 {
+		if entry.sparkline != "" {
+			embed.Footer = &discordgo.MessageEmbedFooter{
+				Text: fmt.Sprintf("%s  %s", strings.ToUpper(rangeArg), entry.sparkline),
+			}
+		}
+		_, err = s.ChannelMessageSendEmbed(m.ChannelID, embed)
+		return err
+	}
 
-	// parsedStamp, err := strconv.ParseInt(t.LastUpdated, 10, 64)
-	// if err == nil {
-	// 	timestamp := unixToTime(parsedStamp)
-	// 	embed.Timestamp = timestamp.Format("2017-12-14T23:26:52.599Z")
-	// }
+	embed.Image = &discordgo.MessageEmbedImage{URL: "attachment://chart.png"}
+	_, err = s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embed: embed,
+		Files: []*discordgo.File{
+			{Name: "chart.png", Reader: bytes.NewReader(entry.png)},
+		},
+	})
+	return err
+}
+
+func makeEmbed(t Ticker, profile sourceProfile) *discordgo.MessageEmbed {
+	embed := discordgo.MessageEmbed{}
+
+	embed.Title = profile.Name
+	embed.URL = profile.URL
+	if t.Change24H >= 0 {
+		embed.Color = colorUp
+	} else {
+		embed.Color = colorDown
+	}
 
 	embed.Author = &discordgo.MessageEmbedAuthor{
 		Name:    fmt.Sprintf("%s (%s)", t.Name, t.Symbol),
-		IconURL: fmt.Sprintf("https://files.coinmarketcap.com/static/img/coins/32x32/%s.png", t.ID),
+		IconURL: profile.IconURL,
 	}
 
 	fields := make([]*discordgo.MessageEmbedField, 0)
 
 	fields = append(fields, &discordgo.MessageEmbedField{
 		Name:  "Coin Market Cap Rank",
-		Value: fmt.Sprintf("#%s", t.Rank),
+		Value: fmt.Sprintf("#%d", t.Rank),
 	})
 
 	fields = append(fields, &discordgo.MessageEmbedField{
-		Name:   "Price USD",
-		Value:  fmt.Sprintf("$%s", t.PriceUSD),
+		Name:   fmt.Sprintf("Price %s", t.Fiat),
+		Value:  formatPrice(t.Price),
 		Inline: true,
 	})
 
 	fields = append(fields, &discordgo.MessageEmbedField{
-		Name:   "Price BTC",
-		Value:  fmt.Sprintf("%s BTC", t.PriceBTC),
+		Name:   "Market Cap",
+		Value:  humanize.Commaf(t.MarketCap),
 		Inline: true,
 	})
 
-	parsedCap, err := strconv.ParseInt(t.LastUpdated, 10, 64)
-	if err == nil {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:  "Market Cap",
-			Value: fmt.Sprintf("$%s", humanize.Comma(parsedCap)),
-		})
-	}
-
-	parsed1H, err := strconv.ParseFloat(t.Change1H, 64)
-	if err == nil {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Percent Change 1 hour",
-			Value:  fmt.Sprintf("%.2f%%", parsed1H),
-			Inline: true,
-		})
-	}
+	fields = append(fields, &discordgo.MessageEmbedField{
+		Name:   "Percent Change 1 hour",
+		Value:  formatChange(t.Change1H),
+		Inline: true,
+	})
 
-	parsed24H, err := strconv.ParseFloat(t.Change24H, 64)
-	if err == nil {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Percent Change 1 hour",
-			Value:  fmt.Sprintf("%.2f%%", parsed24H),
-			Inline: true,
-		})
-	}
+	fields = append(fields, &discordgo.MessageEmbedField{
+		Name:   "Percent Change 24 hours",
+		Value:  formatChange(t.Change24H),
+		Inline: true,
+	})
 
-	parsed7D, err := strconv.ParseFloat(t.Change7D, 64)
-	if err == nil {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Percent Change 1 hour",
-			Value:  fmt.Sprintf("%.2f%%", parsed7D),
-			Inline: true,
-		})
-	}
+	fields = append(fields, &discordgo.MessageEmbedField{
+		Name:   "Percent Change 7 days",
+		Value:  formatChange(t.Change7D),
+		Inline: true,
+	})
 
 	embed.Fields = fields
 
 	return &embed
 }
 
-func findTicker(t string) (tickerResponse, bool) {
+// formatPrice renders a price with adaptive precision: comma-grouped with
+// 2 decimals for anything worth a cent or more, scientific notation for the
+// small-cap/low-unit-price coins where 2 decimals would just print "0.00".
+func formatPrice(price float64) string {
+	if math.Abs(price) >= 0.01 {
+		return humanize.FormatFloat("#,###.##", price)
+	}
+	return fmt.Sprintf("%.3e", price)
+}
+
+// formatChange prefixes a percent change with an arrow so the direction
+// reads clearly even without per-field coloring, which the Discord embed
+// format doesn't support.
+func formatChange(pct float64) string {
+	arrow := "▲"
+	if pct < 0 {
+		arrow = "▼"
+	}
+	return fmt.Sprintf("%s %.2f%%", arrow, pct)
+}
+
+func findTicker(t string) (Ticker, bool) {
 	for _, ticker := range tickers {
 		if strings.EqualFold(ticker.Name, t) || strings.EqualFold(ticker.Symbol, t) {
 			return ticker, true
 		}
 	}
 
-	var nullTicker tickerResponse
+	var nullTicker Ticker
 	return nullTicker, false
 }
 
@@ -293,7 +412,3 @@ func isInSlice(s string, slice []string) bool {
 
 	return false
 }
-
-func unixToTime(stamp int64) time.Time {
-	return time.Unix(stamp, 0)
-}
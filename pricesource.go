@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// PriceSource abstracts a provider of cryptocurrency market data so the bot
+// can switch backends (CoinMarketCap, CoinGecko, ...) without touching the
+// command handling code.
+type PriceSource interface {
+	// List returns the full set of currently tracked tickers, priced in USD.
+	List(ctx context.Context) ([]Ticker, error)
+	// Quote returns a single, fresh ticker for the given coin id (the
+	// provider's slug, i.e. Ticker.ID - not the ticker symbol), priced in
+	// vsCurrency (e.g. "usd", "eur"). An empty vsCurrency means USD.
+	Quote(ctx context.Context, id, vsCurrency string) (Ticker, error)
+	// Profile returns the web presence to link/embed for t, plus the id to
+	// use when fetching its OHLC chart data. Chart data always comes from
+	// CoinGecko (see charts.go) regardless of the active PriceSource, so a
+	// backend whose Ticker.ID isn't already a CoinGecko id must translate it.
+	Profile(t Ticker) sourceProfile
+}
+
+// sourceProfile is the backend-specific presentation for a Ticker: where to
+// link/brand the quote embed, and which id to hand to CoinGecko's OHLC
+// endpoint for charting.
+type sourceProfile struct {
+	Name    string
+	URL     string
+	IconURL string
+	ChartID string
+}
+
+// Ticker is the internal, normalized representation of a coin's market
+// data. Each PriceSource is responsible for mapping its own response
+// schema onto this struct.
+type Ticker struct {
+	ID          string
+	Name        string
+	Symbol      string
+	Rank        int
+	Fiat        string
+	Price       float64
+	MarketCap   float64
+	Change1H    float64
+	Change24H   float64
+	Change7D    float64
+	LastUpdated time.Time
+}
+
+// newPriceSource selects a PriceSource implementation based on config.
+func newPriceSource(c config) PriceSource {
+	switch c.Source {
+	case "coinmarketcappro", "":
+		return newCoinMarketCapPro(c)
+	case "coingecko":
+		return newCoinGecko()
+	default:
+		log.Printf("Unknown source %q, falling back to coinmarketcappro", c.Source)
+		return newCoinMarketCapPro(c)
+	}
+}
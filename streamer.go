@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	binanceStreamURL = "wss://stream.binance.com:9443/ws/!ticker@arr"
+	streamPingPeriod = 3 * time.Minute
+	streamMaxBackoff = time.Minute
+)
+
+// streamer maintains a live, continuously-updated ticker cache fed by an
+// exchange websocket, so "!c" quotes can be served instantly instead of
+// waiting on the next scheduled REST poll. It falls back transparently:
+// callers should check Get's second return value and fall through to the
+// REST PriceSource whenever the stream is down.
+type streamer struct {
+	mu        sync.RWMutex
+	cache     map[string]Ticker
+	connected bool
+}
+
+func newStreamer() *streamer {
+	return &streamer{cache: make(map[string]Ticker)}
+}
+
+// run connects to the exchange stream and reconnects with exponential
+// backoff whenever the connection drops. It never returns; call it in its
+// own goroutine.
+func (st *streamer) run() {
+	backoff := time.Second
+	for {
+		err := st.connectAndStream()
+		if err != nil {
+			log.Println("streamer:", err)
+		}
+
+		st.mu.Lock()
+		st.connected = false
+		st.mu.Unlock()
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > streamMaxBackoff {
+			backoff = streamMaxBackoff
+		}
+	}
+}
+
+func (st *streamer) connectAndStream() error {
+	conn, _, err := websocket.DefaultDialer.Dial(binanceStreamURL, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	st.mu.Lock()
+	st.connected = true
+	st.mu.Unlock()
+	log.Println("streamer: connected")
+
+	pingTicker := time.NewTicker(streamPingPeriod)
+	defer pingTicker.Stop()
+
+	msgs := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			msgs <- msg
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-msgs:
+			st.handleMessage(msg)
+		case <-pingTicker.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return err
+			}
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// binanceTicker is the subset of Binance's 24hr ticker stream payload we
+// care about. See https://binance-docs.github.io/apidocs for the full
+// schema.
+type binanceTicker struct {
+	Symbol             string `json:"s"`
+	LastPrice          string `json:"c"`
+	PriceChangePercent string `json:"P"`
+}
+
+func (st *streamer) handleMessage(msg []byte) {
+	var raw []binanceTicker
+	if err := json.Unmarshal(msg, &raw); err != nil {
+		return
+	}
+
+	for _, bt := range raw {
+		symbol := strings.ToUpper(strings.TrimSuffix(bt.Symbol, "USDT"))
+		if symbol == strings.ToUpper(bt.Symbol) {
+			continue // only USDT-quoted pairs carry a USD-comparable price
+		}
+
+		price, err := strconv.ParseFloat(bt.LastPrice, 64)
+		if err != nil {
+			continue
+		}
+
+		change24h, err := strconv.ParseFloat(bt.PriceChangePercent, 64)
+		if err != nil {
+			continue
+		}
+
+		st.mu.Lock()
+		t := st.cache[symbol]
+		if t.Name == "" {
+			if existing, found := findTicker(symbol); found {
+				t = existing
+			}
+		}
+		if t.ID == "" {
+			t.ID = strings.ToLower(symbol)
+		}
+		t.Symbol = symbol
+		t.Fiat = "USD"
+		t.Price = price
+		t.Change24H = change24h
+		t.LastUpdated = time.Now()
+		st.cache[symbol] = t
+		st.mu.Unlock()
+	}
+}
+
+// Get returns a cached live quote for symbol. The second return value is
+// false whenever the stream doesn't have (or isn't currently able to
+// refresh) that symbol, signalling the caller to fall back to the REST
+// PriceSource.
+func (st *streamer) Get(symbol string) (Ticker, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if !st.connected {
+		return Ticker{}, false
+	}
+
+	t, ok := st.cache[strings.ToUpper(symbol)]
+	return t, ok
+}